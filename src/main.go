@@ -2,18 +2,28 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 	"gopkg.in/yaml.v3"
@@ -36,10 +46,112 @@ type Config struct {
 		CertPath string `yaml:"cert_path"`
 		KeyPath  string `yaml:"key_path"`
 	} `yaml:"ssl"`
-	LogFiles []struct {
-		Path string `yaml:"path"`
-		Name string `yaml:"name"`
-	} `yaml:"log_files"`
+	LogFiles []LogFile `yaml:"log_files"`
+	Retry    struct {
+		InitialBackoff time.Duration `yaml:"initial_backoff"`
+		MaxBackoff     time.Duration `yaml:"max_backoff"`
+		MaxAttempts    int           `yaml:"max_attempts"`
+	} `yaml:"retry"`
+	Alerts       []*AlertRule `yaml:"alerts"`
+	PublicStatus struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"public_status"`
+}
+
+// LogFile is a log_files entry. Entries with Paths are virtual files that
+// show several logs as one, sharing the entry's read settings. History is
+// merged in the listed order and new lines from every path are streamed live.
+type LogFile struct {
+	Path      string   `yaml:"path"`
+	Paths     []string `yaml:"paths"`
+	Name      string   `yaml:"name"`
+	ReadMode  string   `yaml:"read_mode"`
+	Delimiter string   `yaml:"delimiter"`
+}
+
+// virtualPrefix marks file parameters that refer to a virtual file by name.
+const virtualPrefix = "virtual:"
+
+// ID is how the viewer and the API refer to the entry.
+func (lf LogFile) ID() string {
+	if len(lf.Paths) > 0 {
+		return virtualPrefix + lf.Name
+	}
+	return lf.Path
+}
+
+func findLogFile(logPath string) *LogFile {
+	for i := range config.LogFiles {
+		if config.LogFiles[i].ID() == logPath {
+			return &config.LogFiles[i]
+		}
+	}
+	return nil
+}
+
+// sourcesFor returns the files behind logPath: the paths of a virtual file,
+// or logPath itself. Unknown virtual files have no sources, so a path that
+// starts with "virtual:" is only read when it is listed in log_files.
+func sourcesFor(logPath string) []string {
+	logFile := findLogFile(logPath)
+	if logFile != nil && len(logFile.Paths) > 0 {
+		return logFile.Paths
+	}
+	if logFile == nil && strings.HasPrefix(logPath, virtualPrefix) {
+		return nil
+	}
+	return []string{logPath}
+}
+
+// isLogFile reports whether every file behind logPath is a .log file.
+func isLogFile(logPath string) bool {
+	sources := sourcesFor(logPath)
+	for _, source := range sources {
+		if !strings.HasSuffix(source, ".log") {
+			return false
+		}
+	}
+	return len(sources) > 0
+}
+
+// logExists reports whether any file behind logPath exists.
+func logExists(logPath string) bool {
+	for _, source := range sourcesFor(logPath) {
+		if _, err := os.Stat(source); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// readRecords reads every record behind logPath, source by source. Missing
+// sources of a virtual file are skipped, the error is only returned when
+// nothing could be read.
+func readRecords(logPath string) ([]string, error) {
+	var records []string
+	var lastErr error
+	opened := false
+	for _, source := range sourcesFor(logPath) {
+		file, err := os.Open(source)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		opened = true
+
+		scanner := newRecordScanner(file, logPath)
+		for scanner.Scan() {
+			records = append(records, scanner.Text())
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if !opened && lastErr != nil {
+		return nil, lastErr
+	}
+	return records, nil
 }
 
 type User struct {
@@ -111,10 +223,22 @@ func matchPath(pattern, path string) bool {
 	return false
 }
 
+// hasAccess reports whether user may read logPath. Virtual files need
+// access to every path they combine.
 func hasAccess(user *User, logPath string) bool {
+	sources := sourcesFor(logPath)
 	if user.Role == "admin" {
-		return true
+		return len(sources) > 0
+	}
+	for _, source := range sources {
+		if !hasPathAccess(user, source) {
+			return false
+		}
 	}
+	return len(sources) > 0
+}
+
+func hasPathAccess(user *User, logPath string) bool {
 	for _, allowedPath := range user.AllowedPaths {
 		if matchPath(allowedPath, logPath) {
 			return true
@@ -131,104 +255,1089 @@ func getUserFromContext(r *http.Request) *User {
 	return nil
 }
 
+// pollInterval is how often an idle tailer checks its file for new data,
+// rotation and truncation.
+const pollInterval = 500 * time.Millisecond
+
+// Read strategies for log_files entries, selected with read_mode.
+const (
+	readModeLine      = "line"
+	readModeChunk     = "chunk"
+	readModeDelimited = "delimited"
+)
+
+// chunkSize caps a single message in chunk mode.
+const chunkSize = 4096
+
+// maxRecordSize is the longest line or record history can be read with.
+const maxRecordSize = 1024 * 1024
+
+func newSplitFunc(mode, delimiter string) (bufio.SplitFunc, error) {
+	switch mode {
+	case "", readModeLine:
+		return bufio.ScanLines, nil
+	case readModeChunk:
+		return scanChunks, nil
+	case readModeDelimited:
+		if delimiter == "" {
+			return nil, fmt.Errorf("read_mode %q needs a delimiter", mode)
+		}
+		return scanDelimited([]byte(delimiter)), nil
+	}
+	return nil, fmt.Errorf("unknown read_mode %q", mode)
+}
+
+// splitFuncFor returns the record splitter configured for logPath. Paths
+// that are not listed in log_files are read line by line.
+func splitFuncFor(logPath string) bufio.SplitFunc {
+	if logFile := findLogFile(logPath); logFile != nil {
+		if split, err := newSplitFunc(logFile.ReadMode, logFile.Delimiter); err == nil {
+			return split
+		}
+	}
+	return bufio.ScanLines
+}
+
+func newRecordScanner(file *os.File, logPath string) *bufio.Scanner {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	scanner.Split(splitFuncFor(logPath))
+	return scanner
+}
+
+// scanChunks hands out raw bytes as soon as they are available, for
+// producers that never write newlines. Chunks never end inside a UTF-8
+// sequence so every message stays valid text.
+func scanChunks(data []byte, atEOF bool) (int, []byte, error) {
+	n := len(data)
+	if n > chunkSize {
+		n = chunkSize
+	}
+	if n < len(data) || !atEOF {
+		for i := 1; i < utf8.UTFMax && i <= n; i++ {
+			if utf8.RuneStart(data[n-i]) {
+				if !utf8.FullRune(data[n-i : n]) {
+					n -= i
+				}
+				break
+			}
+		}
+	}
+	if n == 0 {
+		return 0, nil, nil
+	}
+	return n, data[:n], nil
+}
+
+// scanDelimited splits records on a custom delimiter such as "\x1e" for
+// RS-separated JSON. Surrounding newlines are trimmed and empty records
+// are skipped. It only returns a nil token once data holds no further
+// record, since bufio.Scanner stops at the first nil token after EOF.
+func scanDelimited(delimiter []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		start := 0
+		for {
+			i := bytes.Index(data[start:], delimiter)
+			if i < 0 {
+				break
+			}
+			next := start + i + len(delimiter)
+			if record := trimRecord(data[start : start+i]); record != nil {
+				return next, record, nil
+			}
+			start = next
+		}
+		if atEOF && start < len(data) {
+			return len(data), trimRecord(data[start:]), nil
+		}
+		return start, nil, nil
+	}
+}
+
+func trimRecord(record []byte) []byte {
+	record = bytes.Trim(record, "\r\n")
+	if len(record) == 0 {
+		return nil
+	}
+	return record
+}
+
+// clientQueueSize is how many frames may wait for a slow client before new
+// ones are dropped.
+const clientQueueSize = 1024
+
+// Client owns one WebSocket connection. All writes go through its queue and
+// a single writer goroutine, so a slow client never stalls the tailer and
+// frames are never written concurrently.
+type Client struct {
+	conn      *websocket.Conn
+	send      chan string
+	done      chan struct{}
+	dropped   int64
+	reason    *APIError
+	closeOnce sync.Once
+}
+
+func NewClient(conn *websocket.Conn) *Client {
+	client := &Client{
+		conn: conn,
+		send: make(chan string, clientQueueSize),
+		done: make(chan struct{}),
+	}
+	go client.writeLoop()
+	return client
+}
+
+func (c *Client) writeLoop() {
+	for {
+		select {
+		case message := <-c.send:
+			if err := c.conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+				c.Close()
+				return
+			}
+		case <-c.done:
+			if c.reason != nil {
+				c.flush()
+				c.reason.Close(c.conn)
+			}
+			return
+		}
+	}
+}
+
+// flush writes whatever is still queued, so the frames leading up to an
+// error arrive before it.
+func (c *Client) flush() {
+	for {
+		select {
+		case message := <-c.send:
+			if c.conn.WriteMessage(websocket.TextMessage, []byte(message)) != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Send queues message and drops it when the client has fallen behind.
+func (c *Client) Send(message string) {
+	select {
+	case c.send <- message:
+	case <-c.done:
+	default:
+		atomic.AddInt64(&c.dropped, 1)
+	}
+}
+
+// SendWait queues message, waiting for room. History is sent this way so
+// it always arrives complete.
+func (c *Client) SendWait(message string) {
+	select {
+	case c.send <- message:
+	case <-c.done:
+	}
+}
+
+// Dropped returns how many frames were discarded for this client.
+func (c *Client) Dropped() int64 {
+	return atomic.LoadInt64(&c.dropped)
+}
+
+func (c *Client) Closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// Fail sends apiErr and closes the connection with its close code, so the
+// viewer knows not to reconnect. The writer goroutine does the sending to
+// keep writes sequential.
+func (c *Client) Fail(apiErr *APIError) {
+	c.closeOnce.Do(func() {
+		c.reason = apiErr
+		close(c.done)
+	})
+}
+
+// recentSize is how many records are sent to a new client, and how many
+// each streamer keeps in memory for when the file cannot be read.
+const recentSize = 200
+
+// idleTimeout is how long a streamer keeps running after its last client
+// left, so a viewer that reconnects during a rotation or permission change
+// still finds the recent records in memory.
+const idleTimeout = recentSize * pollInterval
+
 type LogStreamer struct {
-	clients  []*websocket.Conn
+	clients  []*Client
 	filename string
+	sources  []string
+	split    bufio.SplitFunc
+	recent   []string
+	pinned   bool
+	idleAt   time.Time
+	stopped  bool
+	done     chan struct{}
 	mutex    sync.Mutex
 }
 
 func NewLogStreamer(filepath string) (*LogStreamer, error) {
-	if _, err := os.Stat(filepath); os.IsNotExist(err) {
-		return nil, err
+	sources := sourcesFor(filepath)
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("unknown virtual file %s", filepath)
+	}
+
+	// Missing or unreadable files from log_files are retried by the tailer,
+	// anything else is an error
+	for _, source := range sources {
+		_, err := os.Stat(source)
+		if err != nil && (!isRetryable(err) || !isConfiguredPath(source)) {
+			return nil, err
+		}
 	}
 
 	return &LogStreamer{
-		clients:  make([]*websocket.Conn, 0),
+		clients:  make([]*Client, 0),
 		filename: filepath,
+		sources:  sources,
+		split:    splitFuncFor(filepath),
+		done:     make(chan struct{}),
 	}, nil
 }
 
-func (ls *LogStreamer) AddClient(conn *websocket.Conn) {
+// isRetryable reports whether err may go away by itself, e.g. a file that is
+// about to be created or whose permissions are being fixed.
+func isRetryable(err error) bool {
+	return os.IsNotExist(err) || os.IsPermission(err)
+}
+
+// isConfiguredPath reports whether path is listed in log_files, directly
+// or as part of a virtual file.
+func isConfiguredPath(path string) bool {
+	return ownerOf(path) != ""
+}
+
+// ownerOf returns the ID of the first log_files entry that lists path. Its
+// streamer checks the path's lines against alert rules, split with the
+// entry's read settings.
+func ownerOf(path string) string {
+	for _, logFile := range config.LogFiles {
+		for _, source := range sourcesFor(logFile.ID()) {
+			if source == path {
+				return logFile.ID()
+			}
+		}
+	}
+	return ""
+}
+
+// AddClient registers client and sends it the recent history. It returns
+// false when the streamer has already stopped.
+func (ls *LogStreamer) AddClient(client *Client) bool {
 	ls.mutex.Lock()
-	ls.clients = append(ls.clients, conn)
+	if ls.stopped {
+		ls.mutex.Unlock()
+		return false
+	}
+	ls.clients = append(ls.clients, client)
 	ls.mutex.Unlock()
 
 	// Send last 200 lines initially
 	go func() {
-		file, err := os.Open(ls.filename)
+		// Read all lines first
+		lines, err := readRecords(ls.filename)
 		if err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				client.SendWait(readError(ls.filename, err).Frame())
+			}
+			ls.sendRecent(client, err)
 			return
 		}
-		defer file.Close()
 
-		// Read all lines first
-		var lines []string
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			lines = append(lines, scanner.Text())
-		}
+		// Send last 200 lines
+		start := 0
+		if len(lines) > recentSize {
+			start = len(lines) - recentSize
+		}
+
+		for i := start; i < len(lines); i++ {
+			client.SendWait(lines[i])
+		}
+
+		// Send initial line count
+		totalLines := len(lines)
+		shownLines := len(lines) - start
+		client.SendWait(fmt.Sprintf("__META__:INITIAL_LOAD:%d:%d", totalLines, shownLines))
+		client.SendWait(metaEvent("backfill", fmt.Sprintf("Loaded last %d of %d lines", shownLines, totalLines)))
+	}()
+	return true
+}
+
+// sendRecent serves a new client from memory when the file cannot be read,
+// e.g. during a rotation race or a permission change. The client gets the
+// buffered records and live lines, but no history from disk.
+func (ls *LogStreamer) sendRecent(client *Client, err error) {
+	recent := ls.Recent()
+	if len(recent) == 0 {
+		client.SendWait("__META__:INITIAL_LOAD:0:0")
+		if os.IsNotExist(err) {
+			client.SendWait(metaEvent("missing", "File not found, waiting for it to appear"))
+		} else {
+			client.SendWait(metaEvent("unreadable", "File cannot be read, waiting for new lines"))
+		}
+		return
+	}
+
+	log.Printf("Serving %s from memory: %v", ls.filename, err)
+	for _, line := range recent {
+		client.SendWait(line)
+	}
+	client.SendWait(fmt.Sprintf("__META__:INITIAL_LOAD:%d:%d", len(recent), len(recent)))
+	client.SendWait(metaEvent("degraded", fmt.Sprintf("Live-only, history unavailable: showing %d buffered lines", len(recent))))
+}
+
+// Recent returns a copy of the records kept in memory.
+func (ls *LogStreamer) Recent() []string {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	return append([]string(nil), ls.recent...)
+}
+
+// seedRecent fills the in-memory records from disk. It runs once, before
+// the sources are followed, so it never overwrites remembered records.
+func (ls *LogStreamer) seedRecent() {
+	lines, err := readRecords(ls.filename)
+	if err != nil {
+		return
+	}
+	if len(lines) > recentSize {
+		lines = lines[len(lines)-recentSize:]
+	}
+
+	ls.mutex.Lock()
+	ls.recent = append(lines[:0:0], lines...)
+	ls.mutex.Unlock()
+}
+
+func (ls *LogStreamer) remember(record string) {
+	ls.mutex.Lock()
+	ls.recent = append(ls.recent, record)
+	if len(ls.recent) > recentSize {
+		ls.recent = ls.recent[len(ls.recent)-recentSize:]
+	}
+	ls.mutex.Unlock()
+}
+
+// RemoveClient disconnects client. Once nobody is watching the streamer
+// stops after idleTimeout, unless an alert rule pinned it.
+func (ls *LogStreamer) RemoveClient(client *Client) {
+	ls.mutex.Lock()
+	for i, c := range ls.clients {
+		if c == client {
+			ls.clients = append(ls.clients[:i], ls.clients[i+1:]...)
+			break
+		}
+	}
+	idle := len(ls.clients) == 0 && !ls.pinned
+	if idle {
+		ls.idleAt = time.Now()
+	}
+	ls.mutex.Unlock()
+	client.Close()
+
+	if idle {
+		time.AfterFunc(idleTimeout, ls.stopIfIdle)
+	}
+}
+
+// stopIfIdle stops the streamer when it has had no clients for idleTimeout.
+func (ls *LogStreamer) stopIfIdle() {
+	ls.mutex.Lock()
+	idle := len(ls.clients) == 0 && !ls.pinned && !ls.stopped && time.Since(ls.idleAt) >= idleTimeout
+	ls.mutex.Unlock()
+
+	if idle {
+		log.Printf("Stopped streaming for: %s", ls.filename)
+		ls.Stop()
+	}
+}
+
+// Pin keeps the streamer running without clients.
+func (ls *LogStreamer) Pin() {
+	ls.mutex.Lock()
+	ls.pinned = true
+	ls.mutex.Unlock()
+}
+
+func (ls *LogStreamer) Pinned() bool {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	return ls.pinned
+}
+
+func (ls *LogStreamer) Stopped() bool {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	return ls.stopped
+}
+
+func (ls *LogStreamer) Broadcast(message string) {
+	ls.mutex.Lock()
+	for i := len(ls.clients) - 1; i >= 0; i-- {
+		client := ls.clients[i]
+		if client.Closed() {
+			ls.clients = append(ls.clients[:i], ls.clients[i+1:]...)
+			continue
+		}
+		client.Send(message)
+	}
+	ls.mutex.Unlock()
+}
+
+// Stop ends the tailers, disconnects every client and forgets the
+// streamer, so the next connection for the same file starts a fresh one.
+func (ls *LogStreamer) Stop() {
+	ls.stop(nil)
+}
+
+// stop is Stop, sending apiErr to the clients when it is set.
+func (ls *LogStreamer) stop(apiErr *APIError) {
+	removeStreamer(ls)
+
+	ls.mutex.Lock()
+	if !ls.stopped {
+		ls.stopped = true
+		close(ls.done)
+	}
+	for _, client := range ls.clients {
+		if apiErr != nil {
+			client.Fail(apiErr)
+		} else {
+			client.Close()
+		}
+	}
+	ls.clients = nil
+	ls.mutex.Unlock()
+}
+
+// sleep waits for d and reports false when the streamer stopped meanwhile.
+func (ls *LogStreamer) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ls.done:
+		return false
+	}
+}
+
+// Start tails every source of the streamer. The streamer stops once all of
+// them have given up, and tells its clients why so they stop reconnecting.
+func (ls *LogStreamer) Start() {
+	go func() {
+		ls.seedRecent()
+
+		var wg sync.WaitGroup
+		var failed error
+		var failedMutex sync.Mutex
+		for _, source := range ls.sources {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+
+				file, err := os.Open(path)
+				if err != nil && !isRetryable(err) {
+					log.Printf("Error opening %s: %v", path, err)
+				} else {
+					if file != nil {
+						file.Seek(0, 2) // Go to end
+					}
+					err = ls.follow(path, file)
+				}
+				if err != nil {
+					failedMutex.Lock()
+					failed = err
+					failedMutex.Unlock()
+				}
+			}(source)
+		}
+
+		wg.Wait()
+		if failed != nil && !ls.Stopped() {
+			if ls.Pinned() {
+				log.Printf("Alerts stopped for %s: %v", ls.filename, failed)
+			}
+			ls.stop(readError(ls.filename, failed))
+		} else {
+			ls.Stop()
+		}
+	}()
+}
+
+// event broadcasts a status event about path, naming the path when the
+// streamer combines several files.
+func (ls *LogStreamer) event(path, kind, message string) {
+	if len(ls.sources) > 1 {
+		message = filepath.Base(path) + ": " + message
+	}
+	ls.Broadcast(metaEvent(kind, message))
+}
+
+// follow broadcasts lines appended to file, reopening path when it is
+// rotated and rewinding when it is truncated. A nil file means the path could
+// not be opened yet. While the path is missing or unreadable it is re-checked
+// with exponential backoff, and follow gives up after config.Retry.MaxAttempts
+// checks, except for streamers pinned by an alert rule. It returns why it gave
+// up, or nil when the streamer was stopped.
+func (ls *LogStreamer) follow(path string, file *os.File) error {
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	// Only the owning entry checks alerts, so every line is checked once and
+	// paths opened by hand are never checked
+	alerts := ownerOf(path) == ls.filename && !isOwnLog(path, file)
+
+	var pending []byte
+	buf := make([]byte, 32*1024)
+	attempts := 0
+	delay := config.Retry.InitialBackoff
+
+	// retry counts a failed check and reports false once attempts run out
+	retry := func(kind, problem string) bool {
+		attempts++
+		if config.Retry.MaxAttempts > 0 && attempts > config.Retry.MaxAttempts && !ls.Pinned() {
+			log.Printf("Giving up on %s file: %s", kind, path)
+			ls.event(path, kind, fmt.Sprintf("%s after %d attempts, giving up", problem, config.Retry.MaxAttempts))
+			return false
+		}
+		ls.event(path, kind, fmt.Sprintf("%s, retrying in %s (attempt %d)", problem, delay, attempts))
+		return true
+	}
+
+	for {
+		if file != nil {
+			n, err := file.Read(buf)
+			pending = ls.limitPending(path, ls.emitRecords(path, append(pending, buf[:n]...), false, alerts))
+			if err == nil {
+				continue
+			}
+			if err != io.EOF {
+				log.Printf("Error reading %s: %v", path, err)
+				return err
+			}
+		}
+
+		if attempts > 0 {
+			if !ls.sleep(delay) {
+				return nil
+			}
+			delay *= 2
+			if delay > config.Retry.MaxBackoff {
+				delay = config.Retry.MaxBackoff
+			}
+		} else {
+			if !ls.sleep(pollInterval) {
+				return nil
+			}
+		}
+
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			// Keep draining the open handle while the path is gone
+			if !retry("missing", "File not found") {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		var current os.FileInfo
+		if file != nil {
+			if current, err = file.Stat(); err != nil {
+				continue
+			}
+		}
+
+		if current == nil || !os.SameFile(info, current) {
+			next, err := os.Open(path)
+			if os.IsPermission(err) {
+				if !retry("unreadable", "File cannot be read") {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			if file != nil {
+				// Pick up whatever was written before the switch
+				for {
+					n, err := file.Read(buf)
+					pending = ls.limitPending(path, ls.emitRecords(path, append(pending, buf[:n]...), false, alerts))
+					if err != nil {
+						break
+					}
+				}
+				file.Close()
+			}
+			pending = ls.emitRecords(path, pending, true, alerts)
+			file = next
+			alerts = ownerOf(path) == ls.filename && !isOwnLog(path, file)
+
+			if attempts > 0 {
+				log.Printf("Log reappeared: %s", path)
+				ls.event(path, "reopened", fmt.Sprintf("File available again after %d attempts", attempts))
+				attempts = 0
+				delay = config.Retry.InitialBackoff
+			} else {
+				log.Printf("Log rotated: %s", path)
+				ls.event(path, "rotation", "File rotated, following new file")
+			}
+			continue
+		}
+		if attempts > 0 {
+			// The same file came back, e.g. it was moved away and back
+			attempts = 0
+			delay = config.Retry.InitialBackoff
+		}
+
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err == nil && info.Size() < offset {
+			file.Seek(0, io.SeekStart)
+			pending = nil
+			log.Printf("Log truncated: %s", path)
+			ls.event(path, "truncation", "File truncated, reading from start")
+		}
+	}
+}
+
+// limitPending drops an unterminated remainder that outgrew maxRecordSize,
+// which happens when a producer never writes the expected terminator.
+func (ls *LogStreamer) limitPending(path string, pending []byte) []byte {
+	if len(pending) <= maxRecordSize {
+		return pending
+	}
+	log.Printf("Dropped %d unterminated bytes from %s", len(pending), path)
+	ls.event(path, "overflow", fmt.Sprintf("Dropped %d bytes without a record terminator, check read_mode and delimiter", len(pending)))
+	return nil
+}
+
+// emitRecords broadcasts every complete record in data and returns the
+// unterminated remainder. When atEOF is set the remainder is flushed too.
+func (ls *LogStreamer) emitRecords(path string, data []byte, atEOF, alerts bool) []byte {
+	for len(data) > 0 {
+		advance, token, err := ls.split(data, atEOF)
+		if err != nil || advance == 0 {
+			break
+		}
+		if token != nil {
+			ls.remember(string(token))
+			ls.Broadcast(string(token))
+			if alerts {
+				checkAlerts(path, string(token))
+			}
+		}
+		data = data[advance:]
+	}
+	return data
+}
+
+// metaEvent formats a timestamped status event for the viewer's event panel.
+// Events are kept out of the log stream so they never mix with file content.
+func metaEvent(kind, message string) string {
+	return fmt.Sprintf("__META__:EVENT:%s:%d:%s", kind, time.Now().UnixMilli(), message)
+}
+
+var streamers = make(map[string]*LogStreamer)
+var streamersMutex sync.Mutex
+var config Config
+
+// getStreamer returns the running streamer for logPath, starting one if needed.
+func getStreamer(logPath string) (*LogStreamer, error) {
+	streamersMutex.Lock()
+	defer streamersMutex.Unlock()
+
+	if streamer, exists := streamers[logPath]; exists && !streamer.Stopped() {
+		return streamer, nil
+	}
+	streamer, err := NewLogStreamer(logPath)
+	if err != nil {
+		return nil, err
+	}
+	streamers[logPath] = streamer
+	streamer.Start()
+	log.Printf("Started streaming for: %s", logPath)
+	return streamer, nil
+}
+
+// hasRecent reports whether a running streamer holds records for logPath.
+func hasRecent(logPath string) bool {
+	streamersMutex.Lock()
+	streamer, exists := streamers[logPath]
+	streamersMutex.Unlock()
+
+	return exists && len(streamer.Recent()) > 0
+}
+
+func removeStreamer(ls *LogStreamer) {
+	streamersMutex.Lock()
+	defer streamersMutex.Unlock()
+
+	if streamers[ls.filename] == ls {
+		delete(streamers, ls.filename)
+	}
+}
+
+// AlertRule notifies when a line matching Pattern is written to one of
+// Files. The first match is sent right away. Lines whose template (the line
+// with DedupIgnore matches blanked out) repeats inside DedupWindow are
+// collapsed into one summary with a count, sent when the window closes.
+type AlertRule struct {
+	Name        string        `yaml:"name"`
+	Files       []string      `yaml:"files"`
+	Pattern     string        `yaml:"pattern"`
+	Webhook     string        `yaml:"webhook"`
+	DedupWindow time.Duration `yaml:"dedup_window"`
+	DedupIgnore []string      `yaml:"dedup_ignore"`
+
+	matcher   *regexp.Regexp
+	ignore    []*regexp.Regexp
+	pending   map[string]*Alert
+	lastMatch time.Time
+	mutex     sync.Mutex
+}
+
+// Alert is the payload logged and posted to a rule's webhook.
+type Alert struct {
+	Rule      string    `json:"rule"`
+	File      string    `json:"file"`
+	Line      string    `json:"line"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// defaultDedupIgnore strips timestamps, UUIDs, hex ids and numbers, which
+// is enough to group most repeated stack traces and request errors.
+var defaultDedupIgnore = []string{
+	`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`,
+	`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`,
+	`\b0x[0-9a-fA-F]+\b`,
+	`\d+`,
+}
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// ownLog is the file the server's own log output is redirected to, if any.
+// Alerts are never checked against it, since every alert is logged there.
+var ownLog os.FileInfo
+
+// isOwnLog reports whether file is the server's own log.
+func isOwnLog(path string, file *os.File) bool {
+	if ownLog == nil || file == nil {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil || !os.SameFile(info, ownLog) {
+		return false
+	}
+	log.Printf("Alerts disabled for %s: it is catlog's own log", path)
+	return true
+}
+
+// alertFiringPeriod is how long a rule reports as firing after its last match.
+const alertFiringPeriod = 5 * time.Minute
+
+func (rule *AlertRule) compile() error {
+	matcher, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return err
+	}
+
+	patterns := rule.DedupIgnore
+	if len(patterns) == 0 {
+		patterns = defaultDedupIgnore
+	}
+	ignore := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("dedup_ignore %q: %v", pattern, err)
+		}
+		ignore = append(ignore, re)
+	}
+
+	rule.matcher = matcher
+	rule.ignore = ignore
+	rule.pending = make(map[string]*Alert)
+	return nil
+}
+
+// appliesTo reports whether the rule watches logPath. A rule without files
+// watches every file it is checked against, which is every log_files path.
+func (rule *AlertRule) appliesTo(logPath string) bool {
+	if len(rule.Files) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Files {
+		if matchPath(pattern, logPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *AlertRule) template(line string) string {
+	for _, re := range rule.ignore {
+		line = re.ReplaceAllString(line, "#")
+	}
+	return line
+}
+
+func (rule *AlertRule) record(logPath, line string) {
+	now := time.Now()
+
+	rule.mutex.Lock()
+	rule.lastMatch = now
+	rule.mutex.Unlock()
+
+	if rule.DedupWindow <= 0 {
+		go sendAlert(rule, &Alert{Rule: rule.Name, File: logPath, Line: line, Count: 1, FirstSeen: now, LastSeen: now})
+		return
+	}
+
+	key := logPath + "\x00" + rule.template(line)
+
+	rule.mutex.Lock()
+	defer rule.mutex.Unlock()
+
+	if alert, exists := rule.pending[key]; exists {
+		alert.Count++
+		alert.LastSeen = now
+		return
+	}
+	// The first match goes out right away, repeats are summarized by flush
+	alert := &Alert{Rule: rule.Name, File: logPath, Line: line, Count: 1, FirstSeen: now, LastSeen: now}
+	rule.pending[key] = alert
+	first := *alert
+	go sendAlert(rule, &first)
+	time.AfterFunc(rule.DedupWindow, func() { rule.flush(key) })
+}
+
+// State returns "firing", "ok" or "disabled" for rules that failed to compile.
+func (rule *AlertRule) State() string {
+	if rule.matcher == nil {
+		return "disabled"
+	}
+
+	rule.mutex.Lock()
+	defer rule.mutex.Unlock()
+
+	if !rule.lastMatch.IsZero() && time.Since(rule.lastMatch) < alertFiringPeriod {
+		return "firing"
+	}
+	return "ok"
+}
+
+func (rule *AlertRule) flush(key string) {
+	rule.mutex.Lock()
+	alert := rule.pending[key]
+	delete(rule.pending, key)
+	rule.mutex.Unlock()
+
+	// Only send a summary if more matches arrived after the first
+	if alert != nil && alert.Count > 1 {
+		sendAlert(rule, alert)
+	}
+}
+
+func sendAlert(rule *AlertRule, alert *Alert) {
+	// The matched line is left out on purpose, it would match the rule again
+	// wherever this log is tailed
+	log.Printf("ALERT: Rule=%s, File=%s, Count=%d", alert.Rule, alert.File, alert.Count)
+	if rule.Webhook == "" {
+		return
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	resp, err := alertClient.Post(rule.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Alert webhook failed for %s: %v", rule.Name, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Alert webhook failed for %s: %s", rule.Name, resp.Status)
+	}
+}
+
+func checkAlerts(logPath, line string) {
+	for _, rule := range config.Alerts {
+		if rule.matcher != nil && rule.appliesTo(logPath) && rule.matcher.MatchString(line) {
+			rule.record(logPath, line)
+		}
+	}
+}
+
+// startAlertStreamers tails every configured file an alert rule watches, so
+// alerts fire even when nobody has the file open in a browser. Each path is
+// tailed by its owning entry, which may be a virtual file, so records are
+// split the way that entry is configured.
+func startAlertStreamers() {
+	for _, logFile := range config.LogFiles {
+		id := logFile.ID()
+		if !watchedByAlerts(id) {
+			continue
+		}
+		streamer, err := getStreamer(id)
+		if err != nil {
+			log.Printf("Error creating streamer for %s: %v", id, err)
+			continue
+		}
+		streamer.Pin()
+	}
+}
+
+// watchedByAlerts reports whether an alert rule watches a path owned by the
+// log_files entry id.
+func watchedByAlerts(id string) bool {
+	for _, source := range sourcesFor(id) {
+		if ownerOf(source) != id {
+			continue
+		}
+		for _, rule := range config.Alerts {
+			if rule.matcher != nil && rule.appliesTo(source) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Error codes returned in JSON error bodies and WebSocket error frames.
+// Clients branch on the code, the message is only meant for people.
+const (
+	CodeBadRequest     = "BAD_REQUEST"
+	CodeAuthExpired    = "AUTH_EXPIRED"
+	CodeAccessDenied   = "ACCESS_DENIED"
+	CodeFileNotAllowed = "FILE_NOT_ALLOWED"
+	CodeFileNotFound   = "FILE_NOT_FOUND"
+	CodeFileUnreadable = "FILE_UNREADABLE"
+	CodeTooLarge       = "TOO_LARGE"
+	CodeBusy           = "BUSY"
+	CodeInternal       = "INTERNAL"
+)
+
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
 
-		// Send last 200 lines
-		start := 0
-		if len(lines) > 200 {
-			start = len(lines) - 200
-		}
+func newAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
 
-		for i := start; i < len(lines); i++ {
-			conn.WriteMessage(websocket.TextMessage, []byte(lines[i]))
-		}
+// Write sends the error as {"error": {"code": ..., "message": ...}}.
+func (e *APIError) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(map[string]*APIError{"error": e})
+}
 
-		// Send initial line count
-		totalLines := len(lines)
-		shownLines := len(lines) - start
-		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("__META__:INITIAL_LOAD:%d:%d", totalLines, shownLines)))
-	}()
+// Frame formats the error for a WebSocket client.
+func (e *APIError) Frame() string {
+	return fmt.Sprintf("__META__:ERROR:%s:%s", e.Code, e.Message)
 }
 
-func (ls *LogStreamer) RemoveClient(conn *websocket.Conn) {
-	ls.mutex.Lock()
-	for i, client := range ls.clients {
-		if client == conn {
-			ls.clients = append(ls.clients[:i], ls.clients[i+1:]...)
-			break
-		}
+// CloseCode is the WebSocket close code for the error, 4000 plus its status.
+func (e *APIError) CloseCode() int {
+	return 4000 + e.Status
+}
+
+// Send writes the error to r. Browsers cannot read the response to a
+// failed WebSocket handshake, so upgrade requests are upgraded first and
+// get the error as a frame before the connection is closed.
+func (e *APIError) Send(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		e.Write(w)
+		return
 	}
-	ls.mutex.Unlock()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	e.Close(conn)
+}
+
+// Close sends the error frame and closes conn with the error's close code.
+func (e *APIError) Close(conn *websocket.Conn) {
+	conn.WriteMessage(websocket.TextMessage, []byte(e.Frame()))
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(e.CloseCode(), e.Code), time.Now().Add(time.Second))
 	conn.Close()
 }
 
-func (ls *LogStreamer) Broadcast(message string) {
-	ls.mutex.Lock()
-	for i := len(ls.clients) - 1; i >= 0; i-- {
-		client := ls.clients[i]
-		err := client.WriteMessage(websocket.TextMessage, []byte(message))
-		if err != nil {
-			client.Close()
-			ls.clients = append(ls.clients[:i], ls.clients[i+1:]...)
-		}
+// readError classifies an error from reading a log file.
+func readError(logPath string, err error) *APIError {
+	switch {
+	case os.IsNotExist(err):
+		return newAPIError(http.StatusNotFound, CodeFileNotFound, "File not found: "+logPath)
+	case errors.Is(err, bufio.ErrTooLong):
+		return newAPIError(http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("A line in %s is longer than %d bytes", logPath, maxRecordSize))
+	default:
+		return newAPIError(http.StatusInternalServerError, CodeFileUnreadable, "Cannot read file: "+logPath)
 	}
-	ls.mutex.Unlock()
 }
 
-func (ls *LogStreamer) Start() {
-	go func() {
-		file, err := os.Open(ls.filename)
-		if err != nil {
-			return
-		}
-		defer file.Close()
+// checkLogAccess validates a file parameter for user, returning nil when
+// the file may be read.
+func checkLogAccess(user *User, logPath string) *APIError {
+	if logPath == "" {
+		return newAPIError(http.StatusBadRequest, CodeBadRequest, "file parameter required")
+	}
+	if len(sourcesFor(logPath)) == 0 {
+		return newAPIError(http.StatusNotFound, CodeFileNotFound, "Unknown virtual file: "+logPath)
+	}
 
-		file.Seek(0, 2) // Go to end
-		scanner := bufio.NewScanner(file)
+	// Only allow .log files
+	if !isLogFile(logPath) {
+		return newAPIError(http.StatusForbidden, CodeFileNotAllowed, "Only .log files are allowed")
+	}
 
-		for scanner.Scan() {
-			ls.Broadcast(scanner.Text())
-		}
-	}()
+	// Check user access permissions
+	if user != nil && !hasAccess(user, logPath) {
+		log.Printf("ACCESS DENIED: User=%s, Role=%s, Path=%s", user.Username, user.Role, logPath)
+		return newAPIError(http.StatusForbidden, CodeAccessDenied, "Access denied to this log file")
+	}
+	return nil
 }
 
-var streamers = make(map[string]*LogStreamer)
-var config Config
+// isAPIRequest reports whether r comes from a script or the viewer's
+// background requests rather than a page load.
+func isAPIRequest(r *http.Request) bool {
+	return r.URL.Path == "/ws" || strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/admin/")
+}
 
 func requireAuth(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -239,6 +1348,10 @@ func requireAuth(handler http.HandlerFunc) http.HandlerFunc {
 
 		session := getSessionFromRequest(r)
 		if session == nil {
+			if isAPIRequest(r) {
+				newAPIError(http.StatusUnauthorized, CodeAuthExpired, "Session expired, log in again").Send(w, r)
+				return
+			}
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
@@ -247,6 +1360,23 @@ func requireAuth(handler http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// requireAdmin only lets logged in admins through. Without authentication
+// there are no admins, so nobody is.
+func requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromContext(r)
+		if user == nil || user.Role != "admin" {
+			if user != nil {
+				log.Printf("ACCESS DENIED: User=%s, Role=%s, Path=%s", user.Username, user.Role, r.URL.Path)
+			}
+			newAPIError(http.StatusForbidden, CodeAccessDenied, "Admin access required").Write(w)
+			return
+		}
+
+		handler(w, r)
+	})
+}
+
 func handleLogo(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "src/catlog.png")
 }
@@ -555,22 +1685,8 @@ func loadConfig() error {
 
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	logPath := r.URL.Query().Get("file")
-	if logPath == "" {
-		http.Error(w, "file parameter required", http.StatusBadRequest)
-		return
-	}
-
-	// Only allow .log files
-	if !strings.HasSuffix(logPath, ".log") {
-		http.Error(w, "Only .log files are allowed", http.StatusForbidden)
-		return
-	}
-
-	// Check user access permissions
-	user := getUserFromContext(r)
-	if user != nil && !hasAccess(user, logPath) {
-		log.Printf("ACCESS DENIED: User=%s, Role=%s, Path=%s", user.Username, user.Role, logPath)
-		http.Error(w, "Access denied to this log file", http.StatusForbidden)
+	if apiErr := checkLogAccess(getUserFromContext(r), logPath); apiErr != nil {
+		apiErr.Send(w, r)
 		return
 	}
 
@@ -582,47 +1698,47 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	streamer, exists := streamers[logPath]
-	if !exists {
-		streamer, err = NewLogStreamer(logPath)
+	// Retry when the streamer stops between lookup and registration
+	client := NewClient(conn)
+	var streamer *LogStreamer
+	for {
+		streamer, err = getStreamer(logPath)
 		if err != nil {
 			log.Printf("Error creating streamer for %s: %v", logPath, err)
-			conn.WriteMessage(websocket.TextMessage, []byte("Error: "+err.Error()))
-			conn.Close()
+			readError(logPath, err).Close(conn)
+			client.Close()
 			return
 		}
-		streamers[logPath] = streamer
-		streamer.Start()
-		log.Printf("Started streaming for: %s", logPath)
+		if streamer.AddClient(client) {
+			break
+		}
 	}
-
-	streamer.AddClient(conn)
 	log.Printf("Client connected for file: %s", logPath)
 
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("Client disconnected: %v", err)
-			streamer.RemoveClient(conn)
+			streamer.RemoveClient(client)
 			break
 		}
 
+		// Echo pings so the viewer can show round-trip time and drops
+		if strings.HasPrefix(string(message), "PING:") {
+			client.Send(fmt.Sprintf("__META__:PONG:%s:%d", strings.TrimPrefix(string(message), "PING:"), client.Dropped()))
+			continue
+		}
+
 		// Handle load more requests
 		if string(message) == "LOAD_MORE" {
 			go func() {
-				file, err := os.Open(logPath)
+				lines, err := readRecords(logPath)
 				if err != nil {
+					client.Send(readError(logPath, err).Frame())
 					return
 				}
-				defer file.Close()
 
-				var lines []string
-				scanner := bufio.NewScanner(file)
-				for scanner.Scan() {
-					lines = append(lines, scanner.Text())
-				}
-
-				conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("__META__:LOAD_MORE_RESPONSE:%d", len(lines))))
+				client.Send(fmt.Sprintf("__META__:LOAD_MORE_RESPONSE:%d", len(lines)))
 
 				// Send 100 more lines from the requested position
 				// This will be handled by the frontend
@@ -882,10 +1998,11 @@ h1 {
 		hasFiles := false
 		user := getUserFromContext(r)
 		for _, logFile := range config.LogFiles {
-			if _, err := os.Stat(logFile.Path); err == nil {
+			id := logFile.ID()
+			if logExists(id) {
 				// Check if user has access to this log file
-				if user == nil || hasAccess(user, logFile.Path) {
-					fmt.Fprintf(w, `<div class="log-item"><a href="%s?file=%s">%s</a><small>%s</small></div>`, basePath, logFile.Path, logFile.Name, logFile.Path)
+				if user == nil || hasAccess(user, id) {
+					fmt.Fprintf(w, `<div class="log-item"><a href="%s?file=%s">%s</a><small>%s</small></div>`, basePath, url.QueryEscape(id), logFile.Name, strings.Join(sourcesFor(id), ", "))
 					hasFiles = true
 				}
 			}
@@ -899,7 +2016,7 @@ h1 {
 <div class="section">
 <h3>Custom Log File</h3>
 <form class="custom-form" action="%s">
-<input type="text" name="file" placeholder="/path/to/your/log/file" required>
+<input type="text" name="file" placeholder="/path/to/your/log/file or virtual:Name" required>
 <button type="submit">View Log</button>
 </form>
 </div>
@@ -914,27 +2031,22 @@ function logout() {
 		return
 	}
 
-	// Check user access permissions
-	user := getUserFromContext(r)
-	if user != nil && !hasAccess(user, logPath) {
-		log.Printf("ACCESS DENIED: User=%s, Role=%s, Path=%s", user.Username, user.Role, logPath)
-		http.Error(w, "Access denied to this log file", http.StatusForbidden)
-		return
-	}
-
-	// Only allow .log files
-	if !strings.HasSuffix(logPath, ".log") {
-		http.Error(w, "Only .log files are allowed", http.StatusForbidden)
+	if apiErr := checkLogAccess(getUserFromContext(r), logPath); apiErr != nil {
+		http.Error(w, apiErr.Message, apiErr.Status)
 		return
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(logPath); os.IsNotExist(err) {
+	// Check if file exists. Configured files are waited for, and a warm
+	// streamer can still serve live lines
+	if !logExists(logPath) && !hasRecent(logPath) && !isConfiguredPath(logPath) && findLogFile(logPath) == nil {
 		http.Error(w, "File not found: "+logPath, http.StatusNotFound)
 		return
 	}
 
 	filename := filepath.Base(logPath)
+	if logFile := findLogFile(logPath); logFile != nil && len(logFile.Paths) > 0 {
+		filename = logFile.Name
+	}
 	log.Printf("Serving log viewer for file: %s", logPath)
 
 	w.Header().Set("Content-Type", "text/html")
@@ -1000,6 +2112,17 @@ h1 {
     font-size: 24px;
     font-weight: 500;
 }
+#notice {
+    display: none;
+    margin-bottom: 15px;
+    padding: 10px 15px;
+    background: #252526;
+    border: 1px solid #3e3e42;
+    border-left: 4px solid #cca700;
+    border-radius: 4px;
+    color: #e0e0e0;
+    font-size: 13px;
+}
 #status { 
     color: #a0a0a0; 
     margin: 10px 0 0 0; 
@@ -1010,6 +2133,17 @@ h1 {
     display: inline-block;
     border: 1px solid #3e3e42;
 }
+.conn-stats {
+    color: #a0a0a0;
+    margin: 10px 0 0 0;
+    font-size: 13px;
+    padding: 8px 12px;
+    background: #1e1e1e;
+    border-radius: 4px;
+    display: inline-flex;
+    gap: 12px;
+    border: 1px solid #3e3e42;
+}
 .container { 
     padding: 20px; 
     height: calc(100vh - 100px); 
@@ -1066,6 +2200,8 @@ h1 {
     margin: 2px 0; 
     padding: 4px 8px;
     border-radius: 2px;
+    white-space: pre-wrap;
+    overflow-wrap: anywhere;
     transition: background 0.2s;
 }
 .log-line:hover {
@@ -1079,6 +2215,66 @@ h1 {
     0%% { background: rgba(78,201,176,0.1); }
     100%% { background: transparent; }
 }
+#markerBtn {
+    background: #3e3e42;
+    color: #e0e0e0;
+    border: none;
+    padding: 10px 16px;
+    border-radius: 4px;
+    cursor: pointer;
+    font-size: 13px;
+    font-weight: 500;
+    font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', 'Roboto Mono', monospace;
+    transition: all 0.2s;
+}
+#markerBtn:hover {
+    background: #555555;
+}
+.event-panel {
+    margin-top: 15px;
+    background: #252526;
+    border: 1px solid #3e3e42;
+    border-radius: 4px;
+    font-size: 13px;
+}
+.event-panel summary {
+    padding: 10px 15px;
+    cursor: pointer;
+    color: #a0a0a0;
+    font-weight: 500;
+}
+.event-panel summary:focus {
+    outline: none;
+    box-shadow: 0 0 0 2px rgba(0,122,204,0.2);
+}
+#events {
+    max-height: 160px;
+    overflow-y: auto;
+    padding: 0 15px 10px 15px;
+}
+.event-item {
+    display: flex;
+    gap: 10px;
+    padding: 3px 0;
+    border-top: 1px solid #3e3e42;
+}
+.event-time {
+    color: #a0a0a0;
+    white-space: nowrap;
+}
+.event-kind {
+    color: #007acc;
+    font-weight: 500;
+    min-width: 80px;
+}
+.event-marker .event-kind { color: #4ec9b0; }
+.event-degraded .event-kind { color: #cca700; }
+.event-disconnect .event-kind,
+.event-dropped .event-kind,
+.event-unreadable .event-kind,
+.event-error .event-kind,
+.event-overflow .event-kind,
+.event-missing .event-kind { color: #f48771; }
 ::-webkit-scrollbar { width: 8px; }
 ::-webkit-scrollbar-track { background: #252526; }
 ::-webkit-scrollbar-thumb { 
@@ -1098,6 +2294,12 @@ h1 {
         <h1>%s</h1>
     </div>
     <div class="header-right">
+        <div class="conn-stats" title="Round-trip time, reconnects, frames dropped by the server and time since the last log line">
+            <span id="pingInfo">ping --</span>
+            <span id="reconnectInfo">0 reconnects</span>
+            <span id="droppedInfo">0 dropped</span>
+            <span id="lastLineInfo">no new lines</span>
+        </div>
         <div id="status">Connecting...</div>
         <button class="logout-btn" onclick="logout()">Logout</button>
     </div>
@@ -1105,9 +2307,15 @@ h1 {
 <div class="container">
     <div class="log-controls">
         <button id="loadMoreBtn" onclick="loadMore()">Load 100 More Lines</button>
+        <button id="markerBtn" onclick="addMarker()">Add Marker</button>
         <span class="log-info" id="logInfo">Loading...</span>
     </div>
+    <div id="notice" role="status"></div>
     <div id="logs"></div>
+    <details class="event-panel" id="eventPanel">
+        <summary>Events (<span id="eventCount">0</span>)</summary>
+        <div id="events" role="log" aria-live="polite" aria-label="Stream events"></div>
+    </details>
 </div>
 <script>
 console.log('Connecting to WebSocket...');
@@ -1115,39 +2323,90 @@ const wsProtocol = location.protocol === 'https:' ? 'wss:' : 'ws:';
 const configBasePath = '%s';
 const wsPath = configBasePath ? configBasePath + '/ws' : '/ws';
 const logFile = '%s';
-const ws = new WebSocket(wsProtocol + '//' + location.host + wsPath + '?file=' + encodeURIComponent(logFile));
+const wsUrl = wsProtocol + '//' + location.host + wsPath + '?file=' + encodeURIComponent(logFile);
 const logs = document.getElementById('logs');
 const status = document.getElementById('status');
 const loadMoreBtn = document.getElementById('loadMoreBtn');
 const logInfo = document.getElementById('logInfo');
+const events = document.getElementById('events');
+const eventCount = document.getElementById('eventCount');
+const notice = document.getElementById('notice');
+const pingInfo = document.getElementById('pingInfo');
+const reconnectInfo = document.getElementById('reconnectInfo');
+const droppedInfo = document.getElementById('droppedInfo');
+const lastLineInfo = document.getElementById('lastLineInfo');
 
 let totalLines = 0;
 let shownLines = 0;
 let allLines = [];
-
-ws.onopen = function() {
+let ws;
+let connectedOnce = false;
+let reconnectDelay = 1000;
+let markerCount = 0;
+let rtt = null;
+let reconnectCount = 0;
+let droppedBase = 0;
+let droppedCurrent = 0;
+let lastLineAt = 0;
+
+function connect() {
+    ws = new WebSocket(wsUrl);
+    ws.onopen = onOpen;
+    ws.onmessage = onMessage;
+    ws.onclose = onClose;
+    ws.onerror = onError;
+}
+
+function onOpen() {
     console.log('WebSocket connected');
     status.textContent = 'CONNECTED';
     status.style.color = '#4ec9b0';
-};
+    if (connectedOnce) {
+        // The server replays recent history on every connect
+        logs.innerHTML = '';
+        notice.style.display = 'none';
+        totalLines = 0;
+        shownLines = 0;
+        reconnectCount++;
+        addEvent('reconnect', Date.now(), 'Reconnected to server');
+    }
+    connectedOnce = true;
+    reconnectDelay = 1000;
+    sendPing();
+}
 
-ws.onmessage = function(event) {
+function onMessage(event) {
     const data = event.data;
 
-    // Handle metadata messages
+    // Metadata never goes into the log stream
     if (data.startsWith('__META__:')) {
         const parts = data.split(':');
         if (parts[1] === 'INITIAL_LOAD') {
             totalLines = parseInt(parts[2]);
             shownLines = parseInt(parts[3]);
             updateLogInfo();
-            return;
-        }
-        if (parts[1] === 'LOAD_MORE_RESPONSE') {
+        } else if (parts[1] === 'LOAD_MORE_RESPONSE') {
             totalLines = parseInt(parts[2]);
-            return;
+        } else if (parts[1] === 'EVENT') {
+            addEvent(parts[2], parseInt(parts[3]), parts.slice(4).join(':'));
+            if (parts[2] === 'degraded') {
+                notice.textContent = parts.slice(4).join(':');
+                notice.style.display = 'block';
+            }
+        } else if (parts[1] === 'ERROR') {
+            handleError(parts[2], parts.slice(3).join(':'));
+        } else if (parts[1] === 'PONG') {
+            rtt = Date.now() - parseInt(parts[2]);
+            const dropped = parseInt(parts[3]);
+            if (dropped > droppedCurrent) {
+                addEvent('dropped', Date.now(), (dropped - droppedCurrent) + ' frames dropped by the server, connection too slow');
+            }
+            droppedCurrent = dropped;
+            updateConnStats();
         }
+        return;
     }
+    lastLineAt = Date.now();
 
     // Regular log line
     const line = document.createElement('div');
@@ -1178,19 +2437,84 @@ ws.onmessage = function(event) {
 
     // Remove animation class after animation completes
     setTimeout(() => line.classList.remove('new'), 500);
-};
+}
 
-ws.onclose = function() {
+function onClose(event) {
     console.log('WebSocket closed');
     status.textContent = 'DISCONNECTED';
     status.style.color = '#f48771';
-};
+    rtt = null;
+    droppedBase += droppedCurrent;
+    droppedCurrent = 0;
+    updateConnStats();
+
+    // 4400-4499 mirror HTTP client errors, retrying will not help
+    if (event.code === 4401) {
+        window.location.href = '/login';
+        return;
+    }
+    if (event.code >= 4400 && event.code < 4500) {
+        addEvent('disconnect', Date.now(), 'Connection closed by the server, not reconnecting');
+        return;
+    }
+    addEvent('disconnect', Date.now(), 'Connection lost, reconnecting in ' + (reconnectDelay / 1000) + 's');
+    setTimeout(connect, reconnectDelay);
+    reconnectDelay = Math.min(reconnectDelay * 2, 30000);
+}
 
-ws.onerror = function(error) {
+function onError(error) {
     console.error('WebSocket error:', error);
     status.textContent = 'DISCONNECTED';
     status.style.color = '#f48771';
-};
+}
+
+function addEvent(kind, timestamp, message) {
+    const item = document.createElement('div');
+    item.className = 'event-item event-' + kind;
+
+    const time = document.createElement('span');
+    time.className = 'event-time';
+    time.textContent = new Date(timestamp).toLocaleTimeString();
+
+    const label = document.createElement('span');
+    label.className = 'event-kind';
+    label.textContent = kind;
+
+    const text = document.createElement('span');
+    text.textContent = message;
+
+    item.append(time, label, text);
+    events.appendChild(item);
+    events.scrollTop = events.scrollHeight;
+    eventCount.textContent = events.children.length;
+}
+
+function handleError(code, message) {
+    if (code === 'AUTH_EXPIRED') {
+        window.location.href = '/login';
+        return;
+    }
+    addEvent('error', Date.now(), code + ': ' + message);
+}
+
+function sendPing() {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send('PING:' + Date.now());
+    }
+    updateConnStats();
+}
+
+function updateConnStats() {
+    pingInfo.textContent = rtt === null ? 'ping --' : 'ping ' + rtt + ' ms';
+    reconnectInfo.textContent = reconnectCount + (reconnectCount === 1 ? ' reconnect' : ' reconnects');
+    droppedInfo.textContent = (droppedBase + droppedCurrent) + ' dropped';
+    lastLineInfo.textContent = lastLineAt ? 'last line ' + Math.round((Date.now() - lastLineAt) / 1000) + 's ago' : 'no new lines';
+}
+
+function addMarker() {
+    markerCount++;
+    addEvent('marker', Date.now(), 'Marker ' + markerCount + ' at line ' + totalLines);
+}
 
 function loadMore() {
     if (shownLines >= totalLines) return;
@@ -1201,7 +2525,12 @@ function loadMore() {
     // Request more lines from server
     const apiPath = configBasePath ? configBasePath + '/api/loadmore' : '/api/loadmore';
     fetch(apiPath + '?file=' + encodeURIComponent(logFile) + '&offset=' + (totalLines - shownLines - 100) + '&limit=100')
-        .then(response => response.json())
+        .then(response => response.json().then(body => {
+            if (!response.ok) {
+                throw body.error || { code: 'INTERNAL', message: response.statusText };
+            }
+            return body;
+        }))
         .then(data => {
             const scrollPos = logs.scrollTop;
             const scrollHeight = logs.scrollHeight;
@@ -1226,6 +2555,9 @@ function loadMore() {
         })
         .catch(error => {
             console.error('Load more failed:', error);
+            if (error.code) {
+                handleError(error.code, error.message);
+            }
             loadMoreBtn.disabled = false;
             loadMoreBtn.textContent = 'Load 100 More Lines';
         });
@@ -1239,6 +2571,9 @@ function updateLogInfo() {
 function logout() {
     window.location.href = '/logout';
 }
+
+connect();
+setInterval(sendPing, 5000);
 </script>
 </body>
 </html>`, filename, basePath, filename, config.BaseURL, logPath)
@@ -1249,47 +2584,33 @@ func handleLoadMore(w http.ResponseWriter, r *http.Request) {
 	offsetStr := r.URL.Query().Get("offset")
 	limitStr := r.URL.Query().Get("limit")
 
-	if logPath == "" {
-		http.Error(w, "file parameter required", http.StatusBadRequest)
-		return
-	}
-
-	// Only allow .log files
-	if !strings.HasSuffix(logPath, ".log") {
-		http.Error(w, "Only .log files are allowed", http.StatusForbidden)
-		return
-	}
-
-	// Check user access permissions
-	user := getUserFromContext(r)
-	if user != nil && !hasAccess(user, logPath) {
-		log.Printf("ACCESS DENIED: User=%s, Role=%s, Path=%s", user.Username, user.Role, logPath)
-		http.Error(w, "Access denied to this log file", http.StatusForbidden)
+	if apiErr := checkLogAccess(getUserFromContext(r), logPath); apiErr != nil {
+		apiErr.Write(w)
 		return
 	}
 
 	offset := 0
 	limit := 100
 
+	var err error
 	if offsetStr != "" {
-		fmt.Sscanf(offsetStr, "%d", &offset)
+		if offset, err = strconv.Atoi(offsetStr); err != nil {
+			newAPIError(http.StatusBadRequest, CodeBadRequest, "offset must be an integer").Write(w)
+			return
+		}
 	}
 	if limitStr != "" {
-		fmt.Sscanf(limitStr, "%d", &limit)
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 0 {
+			newAPIError(http.StatusBadRequest, CodeBadRequest, "limit must be a non-negative integer").Write(w)
+			return
+		}
 	}
 
-	file, err := os.Open(logPath)
+	lines, err := readRecords(logPath)
 	if err != nil {
-		http.Error(w, "Cannot open file", http.StatusInternalServerError)
+		readError(logPath, err).Write(w)
 		return
 	}
-	defer file.Close()
-
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
 
 	// Calculate range
 	start := offset
@@ -1317,6 +2638,142 @@ func handleLoadMore(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// fileHealthInterval is how often the file health behind /status.json is
+// refreshed. Requests are served from the last check, so unauthenticated
+// traffic never touches the disk.
+const fileHealthInterval = 5 * time.Second
+
+// fileHealth holds whether each log_files entry was readable at the last check.
+var fileHealth []bool
+var fileHealthMutex sync.RWMutex
+
+func checkFileHealth() []bool {
+	health := make([]bool, len(config.LogFiles))
+	for i, logFile := range config.LogFiles {
+		// Virtual files are healthy when every path is readable
+		readable := true
+		for _, source := range sourcesFor(logFile.ID()) {
+			file, err := os.Open(source)
+			if err != nil {
+				readable = false
+				break
+			}
+			file.Close()
+		}
+		health[i] = readable
+	}
+	return health
+}
+
+// watchFileHealth keeps refreshing fileHealth in the background.
+func watchFileHealth() {
+	for {
+		time.Sleep(fileHealthInterval)
+		health := checkFileHealth()
+		fileHealthMutex.Lock()
+		fileHealth = health
+		fileHealthMutex.Unlock()
+	}
+}
+
+// handlePublicStatus serves alert states and per-file health for public
+// status pages. It is unauthenticated, so it must never expose paths or log
+// content, only configured display names and booleans.
+func handlePublicStatus(w http.ResponseWriter, r *http.Request) {
+	type alertStatus struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+	}
+	type fileStatus struct {
+		Name    string `json:"name"`
+		Healthy bool   `json:"healthy"`
+	}
+
+	healthy := true
+	alerts := make([]alertStatus, 0, len(config.Alerts))
+	for _, rule := range config.Alerts {
+		alerts = append(alerts, alertStatus{Name: rule.Name, State: rule.State()})
+	}
+
+	fileHealthMutex.RLock()
+	readable := fileHealth
+	fileHealthMutex.RUnlock()
+
+	files := make([]fileStatus, 0, len(config.LogFiles))
+	for i, logFile := range config.LogFiles {
+		healthy = healthy && readable[i]
+		files = append(files, fileStatus{Name: logFile.Name, Healthy: readable[i]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"healthy": healthy,
+		"alerts":  alerts,
+		"files":   files,
+	})
+}
+
+// cpuProfileDuration is how long a CPU profile requested through the admin
+// API samples the running server.
+const cpuProfileDuration = 30 * time.Second
+
+func handleProfile(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("type")
+	if kind != "cpu" && kind != "heap" {
+		newAPIError(http.StatusBadRequest, CodeBadRequest, "type parameter must be cpu or heap").Write(w)
+		return
+	}
+
+	// Snapshots go to a temp file first so a failed capture never sends a
+	// truncated download
+	file, err := os.CreateTemp("", "catlog-"+kind+"-*.pprof")
+	if err != nil {
+		newAPIError(http.StatusInternalServerError, CodeInternal, "Cannot create profile file").Write(w)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	username := ""
+	if user := getUserFromContext(r); user != nil {
+		username = user.Username
+	}
+	log.Printf("PROFILE: User=%s, Type=%s", username, kind)
+
+	if kind == "cpu" {
+		if err := pprof.StartCPUProfile(file); err != nil {
+			newAPIError(http.StatusConflict, CodeBusy, "A CPU profile is already being captured").Write(w)
+			return
+		}
+		select {
+		case <-time.After(cpuProfileDuration):
+			pprof.StopCPUProfile()
+		case <-r.Context().Done():
+			pprof.StopCPUProfile()
+			log.Printf("PROFILE: Type=cpu cancelled by client")
+			return
+		}
+	} else {
+		runtime.GC() // Report up-to-date live objects
+		if err := pprof.WriteHeapProfile(file); err != nil {
+			newAPIError(http.StatusInternalServerError, CodeInternal, "Cannot write heap profile").Write(w)
+			return
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		newAPIError(http.StatusInternalServerError, CodeInternal, "Cannot read profile file").Write(w)
+		return
+	}
+
+	name := filepath.Base(file.Name())
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, time.Now(), file)
+}
+
 func main() {
 	port := flag.String("port", "", "Port to run server on (overrides config)")
 	flag.Parse()
@@ -1328,6 +2785,33 @@ func main() {
 		config.BaseURL = ""
 	}
 
+	// Unusable read strategies fall back to line mode
+	for _, logFile := range config.LogFiles {
+		if _, err := newSplitFunc(logFile.ReadMode, logFile.Delimiter); err != nil {
+			log.Printf("Warning: %s: %v, reading line by line", logFile.ID(), err)
+		}
+	}
+
+	// Apply retry defaults for missing files
+	if config.Retry.InitialBackoff <= 0 {
+		config.Retry.InitialBackoff = time.Second
+	}
+	if config.Retry.MaxBackoff <= 0 {
+		config.Retry.MaxBackoff = 30 * time.Second
+	}
+
+	// Never alert on our own output
+	if info, err := os.Stderr.Stat(); err == nil && info.Mode().IsRegular() {
+		ownLog = info
+	}
+
+	// Rules with invalid patterns are skipped
+	for _, rule := range config.Alerts {
+		if err := rule.compile(); err != nil {
+			log.Printf("Warning: alert %s disabled: %v", rule.Name, err)
+		}
+	}
+
 	// Override port if provided via command line
 	if *port != "" {
 		fmt.Sscanf(*port, "%d", &config.Port)
@@ -1340,6 +2824,15 @@ func main() {
 	http.HandleFunc("/app", requireAuth(handleIndex))
 	http.HandleFunc("/ws", requireAuth(handleWebSocket))
 	http.HandleFunc("/api/loadmore", requireAuth(handleLoadMore))
+	// Profiles expose memory contents, so they need a logged in admin
+	if config.Auth.Enabled {
+		http.HandleFunc("/admin/profile", requireAdmin(handleProfile))
+	}
+	if config.PublicStatus.Enabled {
+		fileHealth = checkFileHealth()
+		go watchFileHealth()
+		http.HandleFunc("/status.json", handlePublicStatus)
+	}
 
 	fmt.Printf("Catlog server starting on port %d\n", config.Port)
 	if config.BaseURL != "" {
@@ -1353,8 +2846,13 @@ func main() {
 	} else {
 		fmt.Printf("Authentication disabled\n")
 	}
+	if config.PublicStatus.Enabled {
+		fmt.Printf("Public status endpoint enabled at /status.json\n")
+	}
 	fmt.Printf("Open http://localhost:%d in your browser\n", config.Port)
 
+	startAlertStreamers()
+
 	if config.SSL.Enabled {
 		log.Fatal(http.ListenAndServeTLS(fmt.Sprintf(":%d", config.Port), config.SSL.CertPath, config.SSL.KeyPath, nil))
 	} else {
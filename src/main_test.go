@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestScanDelimited(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"plain", "a\x1eb", []string{"a", "b"}},
+		{"leading", "\x1ea\x1eb", []string{"a", "b"}},
+		{"doubled", "a\x1e\x1e\x1eb", []string{"a", "b"}},
+		{"leading and doubled", "\x1ea\x1e\x1eb", []string{"a", "b"}},
+		{"trailing", "a\x1eb\x1e", []string{"a", "b"}},
+		{"trailing doubled", "a\x1eb\x1e\x1e\n", []string{"a", "b"}},
+		{"json sequence", "\x1e{\"a\":1}\n\x1e{\"b\":2}\n", []string{`{"a":1}`, `{"b":2}`}},
+		{"only delimiters", "\x1e\x1e\x1e", nil},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := bufio.NewScanner(strings.NewReader(tt.input))
+			scanner.Split(scanDelimited([]byte("\x1e")))
+
+			var got []string
+			for scanner.Scan() {
+				got = append(got, scanner.Text())
+			}
+			if err := scanner.Err(); err != nil {
+				t.Fatalf("scan error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanChunks(t *testing.T) {
+	pad := strings.Repeat("a", chunkSize-1)
+
+	tests := []struct {
+		name        string
+		data        string
+		atEOF       bool
+		wantAdvance int
+		wantToken   string
+	}{
+		{"short", "abc", false, 3, "abc"},
+		{"longer than a chunk", pad + "bc", false, chunkSize, pad + "b"},
+		{"two byte rune split at chunk size", pad + "é", false, chunkSize - 1, pad},
+		{"three byte rune split at chunk size", pad[1:] + "€", false, chunkSize - 2, pad[1:]},
+		{"rune split at chunk size at EOF", pad + "é", true, chunkSize - 1, pad},
+		{"rune ending at chunk size", pad[1:] + "é", false, chunkSize, pad[1:] + "é"},
+		{"trailing partial rune", "ab\xe2\x82", false, 2, "ab"},
+		{"trailing partial rune at EOF", "ab\xe2\x82", true, 4, "ab\xe2\x82"},
+		{"only a partial rune", "\xe2\x82", false, 0, ""},
+		{"invalid byte", "ab\xff", false, 3, "ab\xff"},
+		{"stray continuation bytes", "\x80\x80\x80\x80", false, 4, "\x80\x80\x80\x80"},
+		{"empty at EOF", "", true, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advance, token, err := scanChunks([]byte(tt.data), tt.atEOF)
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if advance != tt.wantAdvance || string(token) != tt.wantToken {
+				t.Errorf("got (%d, %q), want (%d, %q)", advance, token, tt.wantAdvance, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestScanChunksKeepsRunesWhole(t *testing.T) {
+	input := strings.Repeat("日本語ログ", chunkSize)
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	scanner.Split(scanChunks)
+
+	var got strings.Builder
+	for scanner.Scan() {
+		if !utf8.Valid(scanner.Bytes()) {
+			t.Fatalf("chunk of %d bytes is not valid UTF-8", len(scanner.Bytes()))
+		}
+		got.Write(scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+	if got.String() != input {
+		t.Errorf("chunks do not add up to the input")
+	}
+}
+
+// withLogFiles swaps in log_files entries for the duration of a test.
+func withLogFiles(t *testing.T, logFiles ...LogFile) {
+	saved := config.LogFiles
+	config.LogFiles = logFiles
+	t.Cleanup(func() { config.LogFiles = saved })
+}
+
+func accessTestLogFiles(t *testing.T) {
+	withLogFiles(t,
+		LogFile{Name: "API", Path: "/var/log/app/api.log"},
+		LogFile{Name: "Web", Paths: []string{"/var/log/nginx/a.log", "/var/log/nginx/b.log"}},
+		LogFile{Name: "Mixed", Paths: []string{"/var/log/nginx/a.log", "/var/log/app/api.log"}},
+		LogFile{Name: "Bad", Paths: []string{"/var/log/app/api.log", "/etc/passwd"}},
+		LogFile{Name: "Odd", Path: "virtual:odd.log"},
+	)
+}
+
+func TestHasAccess(t *testing.T) {
+	accessTestLogFiles(t)
+
+	admin := &User{Username: "admin", Role: "admin"}
+	nginx := &User{Username: "fe", Role: "frontend", AllowedPaths: []string{"/var/log/nginx/*"}}
+	app := &User{Username: "be", Role: "backend", AllowedPaths: []string{"/var/log/app/*"}}
+	odd := &User{Username: "odd", Role: "odd", AllowedPaths: []string{"virtual:odd.log"}}
+
+	tests := []struct {
+		name    string
+		user    *User
+		logPath string
+		want    bool
+	}{
+		{"plain allowed", app, "/var/log/app/api.log", true},
+		{"plain denied", nginx, "/var/log/app/api.log", false},
+		{"virtual with every path allowed", nginx, "virtual:Web", true},
+		{"virtual with one path denied", nginx, "virtual:Mixed", false},
+		{"virtual with other path denied", app, "virtual:Mixed", false},
+		{"virtual for admin", admin, "virtual:Mixed", true},
+		{"unknown virtual", nginx, "virtual:Nope", false},
+		{"unknown virtual for admin", admin, "virtual:Nope", false},
+		{"virtual name matching an allowed pattern", odd, "virtual:Web", false},
+		{"configured path starting with virtual:", odd, "virtual:odd.log", true},
+		{"unlisted path starting with virtual:", odd, "virtual:other.log", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasAccess(tt.user, tt.logPath); got != tt.want {
+				t.Errorf("hasAccess(%s, %q) = %v, want %v", tt.user.Username, tt.logPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckLogAccess(t *testing.T) {
+	accessTestLogFiles(t)
+
+	admin := &User{Username: "admin", Role: "admin"}
+	nginx := &User{Username: "fe", Role: "frontend", AllowedPaths: []string{"/var/log/nginx/*"}}
+
+	tests := []struct {
+		name    string
+		user    *User
+		logPath string
+		want    string
+	}{
+		{"missing parameter", admin, "", CodeBadRequest},
+		{"plain", admin, "/var/log/app/api.log", ""},
+		{"not a log file", admin, "/etc/passwd", CodeFileNotAllowed},
+		{"virtual", nginx, "virtual:Web", ""},
+		{"virtual with one path denied", nginx, "virtual:Mixed", CodeAccessDenied},
+		{"virtual with one non-log path", admin, "virtual:Bad", CodeFileNotAllowed},
+		{"unknown virtual", admin, "virtual:Nope", CodeFileNotFound},
+		{"unlisted path starting with virtual:", admin, "virtual:other.log", CodeFileNotFound},
+		{"configured path starting with virtual:", admin, "virtual:odd.log", ""},
+		{"auth disabled", nil, "virtual:Mixed", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if apiErr := checkLogAccess(tt.user, tt.logPath); apiErr != nil {
+				got = apiErr.Code
+			}
+			if got != tt.want {
+				t.Errorf("checkLogAccess(%q) = %q, want %q", tt.logPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourcesFor(t *testing.T) {
+	accessTestLogFiles(t)
+
+	tests := []struct {
+		logPath string
+		want    []string
+	}{
+		{"/var/log/app/api.log", []string{"/var/log/app/api.log"}},
+		{"/var/log/unlisted.log", []string{"/var/log/unlisted.log"}},
+		{"virtual:Web", []string{"/var/log/nginx/a.log", "/var/log/nginx/b.log"}},
+		{"virtual:Nope", nil},
+		{"virtual:odd.log", []string{"virtual:odd.log"}},
+	}
+
+	for _, tt := range tests {
+		if got := sourcesFor(tt.logPath); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sourcesFor(%q) = %q, want %q", tt.logPath, got, tt.want)
+		}
+	}
+}
+
+// alertRecorder is a webhook that hands every alert it receives to a channel.
+func alertRecorder(t *testing.T) (string, <-chan Alert) {
+	alerts := make(chan Alert, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("decode alert: %v", err)
+		}
+		alerts <- alert
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, alerts
+}
+
+func nextAlert(t *testing.T, alerts <-chan Alert, within time.Duration) Alert {
+	t.Helper()
+	select {
+	case alert := <-alerts:
+		return alert
+	case <-time.After(within):
+		t.Fatalf("no alert within %s", within)
+		return Alert{}
+	}
+}
+
+func noAlert(t *testing.T, alerts <-chan Alert, within time.Duration) {
+	t.Helper()
+	select {
+	case alert := <-alerts:
+		t.Fatalf("unexpected alert %+v", alert)
+	case <-time.After(within):
+	}
+}
+
+func newTestRule(t *testing.T, webhook string, window time.Duration) *AlertRule {
+	rule := &AlertRule{Name: "errors", Pattern: "ERROR", Webhook: webhook, DedupWindow: window}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+func TestAlertFirstMatchSentRightAway(t *testing.T) {
+	webhook, alerts := alertRecorder(t)
+	rule := newTestRule(t, webhook, time.Hour)
+
+	rule.record("/var/log/app/api.log", "ERROR db timeout")
+	alert := nextAlert(t, alerts, 2*time.Second)
+	if alert.Count != 1 || alert.Line != "ERROR db timeout" || alert.File != "/var/log/app/api.log" {
+		t.Errorf("got %+v", alert)
+	}
+}
+
+func TestAlertRepeatsSummarized(t *testing.T) {
+	webhook, alerts := alertRecorder(t)
+	window := 200 * time.Millisecond
+	rule := newTestRule(t, webhook, window)
+
+	rule.record("/var/log/app/api.log", "ERROR request 17 failed")
+	if first := nextAlert(t, alerts, window/2); first.Count != 1 {
+		t.Fatalf("first alert count = %d, want 1", first.Count)
+	}
+	rule.record("/var/log/app/api.log", "ERROR request 18 failed")
+	rule.record("/var/log/app/api.log", "ERROR request 19 failed")
+
+	summary := nextAlert(t, alerts, 2*time.Second)
+	if summary.Count != 3 {
+		t.Errorf("summary count = %d, want 3", summary.Count)
+	}
+	if summary.Line != "ERROR request 17 failed" {
+		t.Errorf("summary line = %q, want the first match", summary.Line)
+	}
+	if !summary.LastSeen.After(summary.FirstSeen) {
+		t.Errorf("last_seen %s not after first_seen %s", summary.LastSeen, summary.FirstSeen)
+	}
+	noAlert(t, alerts, 2*window)
+}
+
+func TestAlertSingleMatchHasNoSummary(t *testing.T) {
+	webhook, alerts := alertRecorder(t)
+	window := 100 * time.Millisecond
+	rule := newTestRule(t, webhook, window)
+
+	rule.record("/var/log/app/api.log", "ERROR once")
+	nextAlert(t, alerts, 2*time.Second)
+	noAlert(t, alerts, 3*window)
+}
+
+func TestAlertTemplate(t *testing.T) {
+	rule := newTestRule(t, "", time.Minute)
+
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"timestamps", "2024-05-01T10:00:00Z ERROR db down", "2024-05-02 11:30:15.123+02:00 ERROR db down", true},
+		{"uuids", "ERROR job 0b6f2c1e-8d9a-4c3b-9f1e-2a7d5c4b3e21 failed", "ERROR job 9c1d7e2f-1a2b-4c3d-8e4f-5a6b7c8d9e0f failed", true},
+		{"hex ids", "ERROR bad pointer 0x7ffe12", "ERROR bad pointer 0xdeadbeef", true},
+		{"numbers", "ERROR request 17 took 230ms", "ERROR request 4242 took 9ms", true},
+		{"different message", "ERROR db down", "ERROR cache down", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := rule.template(tt.a) == rule.template(tt.b); same != tt.same {
+				t.Errorf("template(%q) = %q, template(%q) = %q", tt.a, rule.template(tt.a), tt.b, rule.template(tt.b))
+			}
+		})
+	}
+}
+
+func TestOwnerOf(t *testing.T) {
+	withLogFiles(t,
+		LogFile{Name: "Events", Paths: []string{"/var/log/app/events.log", "/var/log/app/jobs.log"}, ReadMode: readModeDelimited, Delimiter: "\x1e"},
+		LogFile{Name: "Jobs", Path: "/var/log/app/jobs.log"},
+		LogFile{Name: "API", Path: "/var/log/app/api.log"},
+	)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/var/log/app/events.log", "virtual:Events"},
+		{"/var/log/app/jobs.log", "virtual:Events"},
+		{"/var/log/app/api.log", "/var/log/app/api.log"},
+		{"/var/log/app/unlisted.log", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ownerOf(tt.path); got != tt.want {
+			t.Errorf("ownerOf(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}